@@ -0,0 +1,222 @@
+package main
+
+import (
+	"github.com/atotto/clipboard"
+	"strings"
+)
+
+// Action is a named editor command, invokable by key chord (via bindings)
+// or by name from the command-mode prompt (":w" runs "Save", etc). It
+// returns the same RedrawHint HandleEvent does.
+type Action func(v *View) RedrawHint
+
+// actions is the registry of built-in and plugin-registered commands.
+// Plugins extend it via micro.action(name, fn); see PluginManager.
+var actions = map[string]Action{
+	"Quit":          (*View).actionQuit,
+	"CursorUp":      func(v *View) RedrawHint { v.cursor.Up(); return statusOnly() },
+	"CursorDown":    func(v *View) RedrawHint { v.cursor.Down(); return statusOnly() },
+	"CursorLeft":    func(v *View) RedrawHint { v.cursor.Left(); return statusOnly() },
+	"CursorRight":   func(v *View) RedrawHint { v.cursor.Right(); return statusOnly() },
+	"InsertNewline": (*View).actionInsertNewline,
+	"Escape":        (*View).actionEscape,
+	"Find":          func(v *View) RedrawHint { v.Find(); return dirtyAll(v) },
+	"Replace":       func(v *View) RedrawHint { v.Replace(); return dirtyAll(v) },
+	"InsertSpace":   (*View).actionInsertSpace,
+	"Backspace":     (*View).actionBackspace,
+	"InsertTab":     (*View).actionInsertTab,
+	"Save":          (*View).actionSave,
+	"Undo":          func(v *View) RedrawHint { v.eh.Undo(); v.editGen++; return dirtyAll(v) },
+	"Redo":          func(v *View) RedrawHint { v.eh.Redo(); v.editGen++; return dirtyAll(v) },
+	"Copy":          (*View).actionCopy,
+	"Cut":           (*View).actionCut,
+	"Paste":         (*View).actionPaste,
+	"SelectAll":     (*View).actionSelectAll,
+	"OpenFile":      (*View).actionOpenFile,
+	"Command":       (*View).actionCommand,
+	"PageUp":        func(v *View) RedrawHint { v.PageUp(); return dirtyAll(v) },
+	"PageDown":      func(v *View) RedrawHint { v.PageDown(); return dirtyAll(v) },
+	"HalfPageUp":    func(v *View) RedrawHint { v.HalfPageUp(); return dirtyAll(v) },
+	"HalfPageDown":  func(v *View) RedrawHint { v.HalfPageDown(); return dirtyAll(v) },
+}
+
+// actionQuit confirms before quitting if the buffer is dirty, then closes
+// this view (bound to CtrlQ by default).
+func (v *View) actionQuit() RedrawHint {
+	if v.buf.IsDirty() {
+		quit, canceled := v.m.Prompt("You have unsaved changes. Quit anyway? ")
+		if !canceled && (strings.ToLower(quit) == "yes" || strings.ToLower(quit) == "y") {
+			v.Quit()
+		}
+	} else {
+		v.Quit()
+	}
+	return dirtyAll(v)
+}
+
+// actionInsertNewline inserts a newline, or, while search mode is active,
+// jumps to the next match instead (bound to Enter by default).
+func (v *View) actionInsertNewline() RedrawHint {
+	if v.searchActive {
+		v.FindNext()
+		return dirtyAll(v)
+	}
+	line := v.cursor.y
+	v.insertText(v.cursor.loc, "\n")
+	v.cursor.Right()
+	return dirtyFrom(line, v)
+}
+
+// actionEscape leaves search mode, if active (bound to Escape by default).
+func (v *View) actionEscape() RedrawHint {
+	if v.searchActive {
+		v.clearSearch()
+		return dirtyAll(v)
+	}
+	return noRedraw()
+}
+
+// actionInsertSpace inserts a space (bound to Space by default).
+func (v *View) actionInsertSpace() RedrawHint {
+	line := v.cursor.y
+	v.insertText(v.cursor.loc, " ")
+	v.cursor.Right()
+	return dirtyLine(line)
+}
+
+// actionInsertTab inserts a tab (bound to Tab by default).
+func (v *View) actionInsertTab() RedrawHint {
+	line := v.cursor.y
+	v.insertText(v.cursor.loc, "\t")
+	v.cursor.Right()
+	return dirtyLine(line)
+}
+
+// actionBackspace deletes the selection, or the character before the
+// cursor (bound to Backspace by default).
+func (v *View) actionBackspace() RedrawHint {
+	if v.cursor.HasSelection() {
+		v.cursor.DeleteSelection()
+		v.cursor.ResetSelection()
+		return dirtyAll(v)
+	}
+	if v.cursor.loc <= 0 {
+		return noRedraw()
+	}
+	// We have to do something a bit hacky here because we want to delete
+	// the line by first moving left and then deleting backwards but the
+	// undo redo would place the cursor in the wrong place. So instead we
+	// move left, save the position, move back, delete and restore the
+	// position
+	v.cursor.Left()
+	cx, cy, cloc := v.cursor.x, v.cursor.y, v.cursor.loc
+	v.cursor.Right()
+	v.eh.Remove(v.cursor.loc-1, v.cursor.loc)
+	v.editGen++
+	v.cursor.x, v.cursor.y, v.cursor.loc = cx, cy, cloc
+	return dirtyFrom(cy, v)
+}
+
+// actionSave writes the buffer to disk, prompting for a filename first if
+// it doesn't have one (bound to CtrlS by default).
+func (v *View) actionSave() RedrawHint {
+	if v.buf.path == "" {
+		filename, canceled := v.m.Prompt("Filename: ")
+		if canceled {
+			return dirtyAll(v)
+		}
+		v.buf.path = filename
+		v.buf.name = filename
+	}
+
+	if plugins != nil {
+		plugins.runHooks(plugins.preSave, v)
+	}
+	err := v.buf.Save()
+	if err != nil {
+		v.m.Error(err.Error())
+	}
+	if plugins != nil {
+		plugins.runHooks(plugins.postSave, v)
+	}
+	// Need to redraw the status line
+	return statusOnly()
+}
+
+// actionCopy copies the selection to the clipboard (bound to CtrlC by default).
+func (v *View) actionCopy() RedrawHint {
+	if v.cursor.HasSelection() && !clipboard.Unsupported {
+		clipboard.WriteAll(v.cursor.GetSelection())
+		return statusOnly()
+	}
+	return noRedraw()
+}
+
+// actionCut copies the selection to the clipboard and removes it (bound to
+// CtrlX by default).
+func (v *View) actionCut() RedrawHint {
+	if v.cursor.HasSelection() && !clipboard.Unsupported {
+		clipboard.WriteAll(v.cursor.GetSelection())
+		v.cursor.DeleteSelection()
+		v.cursor.ResetSelection()
+		return dirtyAll(v)
+	}
+	return noRedraw()
+}
+
+// actionPaste inserts the clipboard contents at the cursor, replacing the
+// selection if there is one (bound to CtrlV by default).
+func (v *View) actionPaste() RedrawHint {
+	if clipboard.Unsupported {
+		return noRedraw()
+	}
+	if v.cursor.HasSelection() {
+		v.cursor.DeleteSelection()
+		v.cursor.ResetSelection()
+	}
+	clip, _ := clipboard.ReadAll()
+	v.insertText(v.cursor.loc, clip)
+	// This is a bit weird... Not sure if there's a better way
+	for i := 0; i < Count(clip); i++ {
+		v.cursor.Right()
+	}
+	return dirtyAll(v)
+}
+
+// actionSelectAll selects the whole buffer (bound to CtrlA by default).
+func (v *View) actionSelectAll() RedrawHint {
+	v.cursor.selectionEnd = 0
+	v.cursor.selectionStart = v.buf.Len()
+	v.cursor.x = 0
+	v.cursor.y = 0
+	v.cursor.loc = 0
+	return dirtyAll(v)
+}
+
+// actionOpenFile confirms before discarding unsaved changes, then prompts
+// for a file to open (bound to CtrlO by default).
+func (v *View) actionOpenFile() RedrawHint {
+	if !v.buf.IsDirty() {
+		return v.OpenFile()
+	}
+
+	quit, canceled := v.m.Prompt("You have unsaved changes. Continue? ")
+	if !canceled && (strings.ToLower(quit) == "yes" || strings.ToLower(quit) == "y") {
+		return v.OpenFile()
+	}
+	return dirtyAll(v)
+}
+
+// actionCommand prompts for a command-mode line and runs it through the
+// view's ViewManager, e.g. "vsplit", "close", "buffer 2", "w", "set tabsize
+// 2" (bound to CtrlE by default).
+func (v *View) actionCommand() RedrawHint {
+	if v.vm == nil {
+		return dirtyAll(v)
+	}
+	cmd, canceled := v.m.Prompt(": ")
+	if !canceled {
+		v.vm.ExecuteCommand(cmd)
+	}
+	return dirtyAll(v)
+}
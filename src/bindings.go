@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gdamore/tcell"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Bindings maps a key chord string, e.g. "CtrlS" or "AltRight", to the name
+// of an Action (see actions.go) to run when that chord is pressed.
+type Bindings map[string]string
+
+// bindings is the active key-to-action map. It starts out as
+// DefaultBindings and is replaced wholesale once LoadBindings has merged
+// in the user's config file at startup.
+var bindings = DefaultBindings()
+
+// DefaultBindings returns the editor's built-in keybindings.
+func DefaultBindings() Bindings {
+	return Bindings{
+		"CtrlQ":     "Quit",
+		"Up":        "CursorUp",
+		"Down":      "CursorDown",
+		"Left":      "CursorLeft",
+		"Right":     "CursorRight",
+		"Enter":     "InsertNewline",
+		"Escape":    "Escape",
+		"CtrlF":     "Find",
+		"CtrlR":     "Replace",
+		"Space":     "InsertSpace",
+		"Backspace": "Backspace",
+		"Tab":       "InsertTab",
+		"CtrlS":     "Save",
+		"CtrlZ":     "Undo",
+		"CtrlY":     "Redo",
+		"CtrlC":     "Copy",
+		"CtrlX":     "Cut",
+		"CtrlV":     "Paste",
+		"CtrlA":     "SelectAll",
+		"CtrlO":     "OpenFile",
+		"CtrlE":     "Command",
+		"PageUp":    "PageUp",
+		"PageDown":  "PageDown",
+		"CtrlU":     "HalfPageUp",
+		"CtrlD":     "HalfPageDown",
+	}
+}
+
+// LoadBindings reads a JSON keybindings file (chord string -> action name)
+// from path and merges it over DefaultBindings, so users only need to list
+// the chords they want to change. A missing file is not an error: it just
+// means the defaults are used as-is.
+func LoadBindings(path string) (Bindings, error) {
+	b := DefaultBindings()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return b, err
+	}
+
+	var overrides Bindings
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return b, err
+	}
+	for chord, action := range overrides {
+		b[chord] = action
+	}
+
+	return b, nil
+}
+
+// ConfigDir returns the directory keybindings and plugins are loaded from,
+// honoring $MICRO_CONFIG_DIR if set and otherwise defaulting to
+// ~/.config/micro, following the XDG convention.
+func ConfigDir() string {
+	if dir := os.Getenv("MICRO_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".config/micro"
+	}
+	return filepath.Join(home, ".config", "micro")
+}
+
+// keyNames maps the tcell key constants bindable by DefaultBindings to
+// their chord string form. Keys not listed here (besides KeyRune) cannot
+// currently be bound.
+var keyNames = map[tcell.Key]string{
+	tcell.KeyCtrlQ:      "CtrlQ",
+	tcell.KeyUp:         "Up",
+	tcell.KeyDown:       "Down",
+	tcell.KeyLeft:       "Left",
+	tcell.KeyRight:      "Right",
+	tcell.KeyEnter:      "Enter",
+	tcell.KeyEscape:     "Escape",
+	tcell.KeyCtrlF:      "CtrlF",
+	tcell.KeyCtrlR:      "CtrlR",
+	tcell.KeySpace:      "Space",
+	tcell.KeyBackspace2: "Backspace",
+	tcell.KeyTab:        "Tab",
+	tcell.KeyCtrlS:      "CtrlS",
+	tcell.KeyCtrlZ:      "CtrlZ",
+	tcell.KeyCtrlY:      "CtrlY",
+	tcell.KeyCtrlC:      "CtrlC",
+	tcell.KeyCtrlX:      "CtrlX",
+	tcell.KeyCtrlV:      "CtrlV",
+	tcell.KeyCtrlA:      "CtrlA",
+	tcell.KeyCtrlO:      "CtrlO",
+	tcell.KeyCtrlE:      "CtrlE",
+	tcell.KeyPgUp:       "PageUp",
+	tcell.KeyPgDn:       "PageDown",
+	tcell.KeyCtrlU:      "CtrlU",
+	tcell.KeyCtrlD:      "CtrlD",
+}
+
+// chordString renders a key event as the chord string bindings is keyed
+// by, e.g. "CtrlS" or "AltRight". Alt and Shift are layered onto the base
+// key name as prefixes; Ctrl is already baked into tcell's per-letter key
+// constants (KeyCtrlA..KeyCtrlZ), so it needs no separate prefix.
+func chordString(e *tcell.EventKey) string {
+	base, ok := keyNames[e.Key()]
+	if !ok {
+		if e.Key() != tcell.KeyRune {
+			return ""
+		}
+		base = string(e.Rune())
+	}
+
+	prefix := ""
+	mod := e.Modifiers()
+	if mod&tcell.ModAlt != 0 {
+		prefix += "Alt"
+	}
+	if mod&tcell.ModShift != 0 {
+		prefix += "Shift"
+	}
+	return prefix + base
+}
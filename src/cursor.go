@@ -0,0 +1,159 @@
+package main
+
+import (
+	runewidth "github.com/mattn/go-runewidth"
+	"strings"
+)
+
+// Cursor tracks where editing happens within a View's buffer: an absolute
+// rune offset (loc) plus the (x, y) rune-column/line position it
+// corresponds to, and the bounds of the current selection, if any. x/y and
+// the selection bounds are rune indices, not visual screen columns —
+// GetCharPosInLine is what maps a visual column (where wide glyphs and
+// tabs don't advance one-for-one with runes) back to a rune index.
+type Cursor struct {
+	x, y int
+	loc  int
+
+	selectionStart, selectionEnd     int
+	selectionStartX, selectionStartY int
+
+	v *View
+}
+
+// HasSelection reports whether the cursor has an active, non-empty selection.
+func (c *Cursor) HasSelection() bool {
+	return c.selectionStart != c.selectionEnd
+}
+
+// ResetSelection collapses the selection down to the cursor's current position.
+func (c *Cursor) ResetSelection() {
+	c.selectionStart = c.loc
+	c.selectionEnd = c.loc
+}
+
+// GetSelection returns the selected text, regardless of which end the
+// selection was started from.
+func (c *Cursor) GetSelection() string {
+	lo, hi := c.selectionStart, c.selectionEnd
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	text := []rune(strings.Join(c.v.buf.lines, "\n"))
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(text) {
+		hi = len(text)
+	}
+	return string(text[lo:hi])
+}
+
+// DeleteSelection removes the selected text from the buffer and leaves the
+// cursor at the start of where the selection was.
+func (c *Cursor) DeleteSelection() {
+	lo, hi := c.selectionStart, c.selectionEnd
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	c.v.eh.Remove(lo, hi)
+	c.v.editGen++
+	c.loc = lo
+	c.x, c.y = c.v.locToPos(lo)
+}
+
+// Distance returns the number of runes between the cursor's current
+// location and the absolute position of line y, rune-column x — the value
+// to add to c.loc to move it there.
+func (c *Cursor) Distance(x, y int) int {
+	target := 0
+	for i, line := range c.v.buf.lines {
+		if i == y {
+			target += x
+			break
+		}
+		target += Count(line) + 1 // +1 for the implicit newline
+	}
+	return target - c.loc
+}
+
+// GetCharPosInLine converts a zero-based visual screen column within line
+// y — accounting for wide runes and tabs expanded to tabSize — to the rune
+// index of the character at that column. This walks the line's runes
+// directly rather than lineCells' expanded cell slice: lineCells turns one
+// tab rune into tabSize separate cells, so a cell index there diverges
+// from a rune index on any line containing a tab.
+func (c *Cursor) GetCharPosInLine(y, visualX int) int {
+	if y < 0 || y >= len(c.v.buf.lines) {
+		return 0
+	}
+	runes := []rune(c.v.buf.lines[y])
+	col := 0
+	for i, ch := range runes {
+		w := runewidth.RuneWidth(ch)
+		if ch == '\t' {
+			w = tabSize
+		}
+		if col+w > visualX {
+			return i
+		}
+		col += w
+	}
+	return len(runes)
+}
+
+// Left moves the cursor back one rune, onto the end of the previous line
+// if it's at the start of one.
+func (c *Cursor) Left() {
+	if c.loc <= 0 {
+		return
+	}
+	c.loc--
+	if c.x == 0 {
+		c.y--
+		c.x = Count(c.v.buf.lines[c.y])
+	} else {
+		c.x--
+	}
+}
+
+// Right moves the cursor forward one rune, onto the start of the next line
+// if it's at the end of one.
+func (c *Cursor) Right() {
+	if c.loc >= c.v.buf.Len() {
+		return
+	}
+	c.loc++
+	if c.x >= Count(c.v.buf.lines[c.y]) {
+		c.y++
+		c.x = 0
+	} else {
+		c.x++
+	}
+}
+
+// Up moves the cursor to the line above, keeping the same rune column
+// where possible.
+func (c *Cursor) Up() {
+	if c.y <= 0 {
+		return
+	}
+	c.y--
+	if c.x > Count(c.v.buf.lines[c.y]) {
+		c.x = Count(c.v.buf.lines[c.y])
+	}
+	c.loc += c.Distance(c.x, c.y)
+}
+
+// Down moves the cursor to the line below, keeping the same rune column
+// where possible.
+func (c *Cursor) Down() {
+	if c.y >= len(c.v.buf.lines)-1 {
+		return
+	}
+	c.y++
+	if c.x > Count(c.v.buf.lines[c.y]) {
+		c.x = Count(c.v.buf.lines[c.y])
+	}
+	c.loc += c.Distance(c.x, c.y)
+}
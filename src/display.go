@@ -0,0 +1,377 @@
+package main
+
+import (
+	"github.com/gdamore/tcell"
+	runewidth "github.com/mattn/go-runewidth"
+	"strconv"
+)
+
+// displayCell is one on-screen column drawn by Display: a base rune plus
+// any zero-width combining marks stacked onto it, and the on-screen width
+// the base rune occupies (2 for wide CJK/emoji glyphs, 1 otherwise). Tabs
+// are expanded into space cells before rendering, so they never appear
+// here as '\t'.
+type displayCell struct {
+	ch    rune
+	comb  []rune
+	width int
+	// pad marks all but the last of the space cells a tab expands into, so
+	// Display advances its rune offset once per tab rather than once per cell.
+	pad bool
+}
+
+// lineCells splits a logical line (or a wrapped chunk of one) into the
+// cells Display renders, expanding tabs to tabSize spaces and stacking
+// zero-width combining marks onto the base rune they modify instead of
+// advancing the column.
+func lineCells(line []rune) []displayCell {
+	var cells []displayCell
+	for _, ch := range line {
+		if ch == '\t' {
+			for i := 0; i < tabSize; i++ {
+				cells = append(cells, displayCell{ch: ' ', width: 1, pad: i < tabSize-1})
+			}
+			continue
+		}
+
+		w := runewidth.RuneWidth(ch)
+		if w == 0 && len(cells) > 0 {
+			last := &cells[len(cells)-1]
+			last.comb = append(last.comb, ch)
+			continue
+		}
+		if w == 0 {
+			w = 1 // a leading combining mark has nothing to stack onto
+		}
+		cells = append(cells, displayCell{ch: ch, width: w})
+	}
+	return cells
+}
+
+// visualLineCache memoizes how each logical line wraps into visual rows at
+// a given view width, so ScrollUp/ScrollDown/PageDown can move by visual
+// rows without re-measuring the whole buffer on every keypress. It is
+// rebuilt whenever the view's editGen or width go stale (see
+// View.visualRowsCache).
+type visualLineCache struct {
+	gen   int
+	width int
+
+	rows map[int][][]rune // logical line index -> its wrapped rune chunks
+
+	total    int // sum of len(rows) across every logical line
+	totalSet bool
+}
+
+// visualRowsCache returns this view's visual-line cache, rebuilding it from
+// scratch if the buffer has been edited or the view resized since it was
+// last built.
+func (v *View) visualRowsCache() *visualLineCache {
+	if v.visualCache == nil || v.visualCache.gen != v.editGen || v.visualCache.width != v.width {
+		v.visualCache = &visualLineCache{gen: v.editGen, width: v.width, rows: map[int][][]rune{}}
+	}
+	return v.visualCache
+}
+
+// wrappedRows returns the wrapped rune chunks of logical line n, computing
+// and caching them on first use.
+func (v *View) wrappedRows(n int) [][]rune {
+	cache := v.visualRowsCache()
+	if rows, ok := cache.rows[n]; ok {
+		return rows
+	}
+	width := v.width - v.lineNumOffset
+	if !v.softWrap {
+		width = 0 // one row per logical line
+	}
+	rows := wrapLine([]rune(v.buf.lines[n]), width)
+	cache.rows[n] = rows
+	return rows
+}
+
+// lineWrapCount returns how many visual rows logical line n wraps into at
+// the current view width; always 1 when soft-wrap is off.
+func (v *View) lineWrapCount(n int) int {
+	if !v.softWrap || v.width <= 0 {
+		return 1
+	}
+	rows := v.wrappedRows(n)
+	if len(rows) == 0 {
+		return 1
+	}
+	return len(rows)
+}
+
+// visualHeight is the total number of visual rows the buffer occupies,
+// cached alongside the per-line wrap counts it is built from.
+func (v *View) visualHeight() int {
+	if !v.softWrap {
+		return len(v.buf.lines)
+	}
+	cache := v.visualRowsCache()
+	if !cache.totalSet {
+		total := 0
+		for i := range v.buf.lines {
+			total += v.lineWrapCount(i)
+		}
+		cache.total = total
+		cache.totalSet = true
+	}
+	return cache.total
+}
+
+// wrapLine splits a logical line's runes into chunks that each fit within
+// width display columns, counting wide runes and expanded tabs at their
+// on-screen width rather than one column per rune. A non-positive width
+// (soft-wrap off, or not yet laid out) disables wrapping.
+func wrapLine(runes []rune, width int) [][]rune {
+	if width <= 0 {
+		return [][]rune{runes}
+	}
+
+	var rows [][]rune
+	start := 0
+	col := 0
+	for i, ch := range runes {
+		w := runewidth.RuneWidth(ch)
+		if ch == '\t' {
+			w = tabSize
+		}
+		if col+w > width && i > start {
+			rows = append(rows, runes[start:i])
+			start = i
+			col = 0
+		}
+		col += w
+	}
+	rows = append(rows, runes[start:])
+	return rows
+}
+
+// scrollVisual moves (topline, topSubRow) forward (n > 0) or backward
+// (n < 0) by n visual rows, clamping at the start/end of the buffer. With
+// soft-wrap off this is exactly n logical lines.
+func (v *View) scrollVisual(n int) {
+	if !v.softWrap {
+		v.topline += n
+		if max := len(v.buf.lines) - v.height; v.topline > max {
+			v.topline = max
+		}
+		if v.topline < 0 {
+			v.topline = 0
+		}
+		return
+	}
+
+	for ; n > 0; n-- {
+		if v.topSubRow+1 < v.lineWrapCount(v.topline) {
+			v.topSubRow++
+		} else if v.topline < len(v.buf.lines)-1 {
+			v.topline++
+			v.topSubRow = 0
+		} else {
+			break
+		}
+	}
+	for ; n < 0; n++ {
+		if v.topSubRow > 0 {
+			v.topSubRow--
+		} else if v.topline > 0 {
+			v.topline--
+			v.topSubRow = v.lineWrapCount(v.topline) - 1
+		} else {
+			break
+		}
+	}
+}
+
+// screenToLinePos translates a click at view-relative screen row/column
+// (row 0 is the first drawn row) into the logical line it landed on and
+// the full-line visual column GetCharPosInLine expects, walking wrapped
+// rows from (topline, topSubRow) the same way Display does instead of
+// assuming one screen row is one logical line.
+func (v *View) screenToLinePos(row, col int) (line, visualX int) {
+	line = v.topline
+	subRow := v.topSubRow
+	for r := 0; r < row; r++ {
+		if line >= len(v.buf.lines) {
+			break
+		}
+		rows := v.wrappedRows(line)
+		if subRow+1 < len(rows) {
+			subRow++
+		} else {
+			line++
+			subRow = 0
+		}
+	}
+	if line >= len(v.buf.lines) {
+		return len(v.buf.lines) - 1, col
+	}
+
+	visualX = col
+	for _, chunk := range v.wrappedRows(line)[:subRow] {
+		for _, cell := range lineCells(chunk) {
+			visualX += cell.width
+		}
+	}
+	return line, visualX
+}
+
+// rowSnapshot is everything that determines what a screen row looks like:
+// its wrapped content, where that content starts (so earlier edits that
+// shift it are noticed), and the selection/search-highlight state that can
+// restyle it without changing the text. frameCache compares these to skip
+// repainting rows that are unchanged since the last frame.
+type rowSnapshot struct {
+	content   string
+	charStart int
+	hasSel    bool
+	selLo     int
+	selHi     int
+	searchGen int
+}
+
+// frameCache remembers the snapshot Display last drew at each screen row,
+// so a later Display call can skip rows whose line content and
+// highlighting haven't changed, instead of recomputing and re-sending
+// every visible cell on every redraw. It's invalidated wholesale whenever
+// the view's geometry changes.
+type frameCache struct {
+	width, height int
+	x0, y0        int
+	maxLineLength int
+	rows          map[int]rowSnapshot
+}
+
+// Display renders the view to the screen, repainting only the rows whose
+// content or highlighting actually changed since the last call (tracked in
+// v.lastFrame) rather than redrawing every visible cell unconditionally.
+func (v *View) Display() {
+	maxLineLength := len(strconv.Itoa(len(v.buf.lines)))
+	// + 1 for the little space after the line number
+	v.lineNumOffset = maxLineLength + 1
+
+	cache := v.lastFrame
+	if cache == nil || cache.width != v.width || cache.height != v.height || cache.x0 != v.x0 || cache.y0 != v.y0 || cache.maxLineLength != maxLineLength {
+		cache = &frameCache{width: v.width, height: v.height, x0: v.x0, y0: v.y0, maxLineLength: maxLineLength, rows: map[int]rowSnapshot{}}
+		v.lastFrame = cache
+	}
+
+	lineNumStyle := tcell.StyleDefault
+	if s, ok := colorscheme["line-number"]; ok {
+		lineNumStyle = s
+	}
+
+	hasSel := v.cursor.HasSelection()
+	selLo, selHi := v.cursor.selectionStart, v.cursor.selectionEnd
+	if selLo > selHi {
+		selLo, selHi = selHi, selLo
+	}
+
+	line := v.topline
+	subRow := v.topSubRow
+
+	// charNum tracks the absolute rune offset of the next cell to draw, for
+	// selection/match highlighting; it must skip over any visual rows of
+	// the top line already scrolled past.
+	charNum := v.cursor.loc + v.cursor.Distance(0, v.topline)
+	for _, chunk := range v.wrappedRows(line)[:subRow] {
+		charNum += len(chunk)
+	}
+
+	for row := 0; row < v.height; row++ {
+		if line >= len(v.buf.lines) {
+			break
+		}
+
+		rows := v.wrappedRows(line)
+		chunk := rows[subRow]
+
+		snap := rowSnapshot{
+			content:   string(chunk),
+			charStart: charNum,
+			hasSel:    hasSel,
+			selLo:     selLo,
+			selHi:     selHi,
+			searchGen: v.searchGen,
+		}
+		if prev, ok := cache.rows[row]; ok && prev == snap {
+			charNum = advanceVisualRow(charNum, chunk, rows, &line, &subRow)
+			continue
+		}
+		cache.rows[row] = snap
+
+		x := 0
+		if subRow == 0 {
+			// Write the line number, only on a logical line's first visual row
+			lineNum := strconv.Itoa(line + 1)
+			for i := 0; i < maxLineLength-len(lineNum); i++ {
+				v.s.SetContent(v.x0+x, v.y0+row, ' ', nil, lineNumStyle)
+				x++
+			}
+			for _, ch := range lineNum {
+				v.s.SetContent(v.x0+x, v.y0+row, ch, nil, lineNumStyle)
+				x++
+			}
+		} else {
+			for ; x < maxLineLength; x++ {
+				v.s.SetContent(v.x0+x, v.y0+row, ' ', nil, lineNumStyle)
+			}
+		}
+		// Write the extra space
+		v.s.SetContent(v.x0+x, v.y0+row, ' ', nil, lineNumStyle)
+		x++
+
+		rowCharNum := charNum
+		for _, cell := range lineCells(chunk) {
+			var lineStyle tcell.Style
+			highlightStyle := tcell.StyleDefault
+			if st, ok := v.matches[rowCharNum]; ok {
+				highlightStyle = st
+			}
+
+			if hasSel && rowCharNum >= selLo && rowCharNum <= selHi {
+				lineStyle = tcell.StyleDefault.Reverse(true)
+				if s, ok := colorscheme["selection"]; ok {
+					lineStyle = s
+				}
+			} else {
+				lineStyle = highlightStyle
+			}
+
+			v.s.SetContent(v.x0+x, v.y0+row, cell.ch, cell.comb, lineStyle)
+			x += cell.width
+			if !cell.pad {
+				rowCharNum += 1 + len(cell.comb)
+			}
+		}
+
+		if hasSel && rowCharNum >= selLo && rowCharNum <= selHi {
+			selectStyle := tcell.StyleDefault.Reverse(true)
+			if s, ok := colorscheme["selection"]; ok {
+				selectStyle = s
+			}
+			v.s.SetContent(v.x0+x, v.y0+row, ' ', nil, selectStyle)
+		}
+
+		charNum = advanceVisualRow(charNum, chunk, rows, &line, &subRow)
+	}
+}
+
+// advanceVisualRow moves (line, subRow) past the visual row just processed
+// (whether or not it was actually repainted) and returns the charNum the
+// row after it starts at.
+func advanceVisualRow(charNum int, chunk []rune, rows [][]rune, line, subRow *int) int {
+	charNum += len(chunk)
+	if *subRow+1 < len(rows) {
+		*subRow++
+	} else {
+		// Only the logical line's last visual row actually ends on a
+		// newline; account for it once we've passed that row.
+		charNum++
+		*line++
+		*subRow = 0
+	}
+	return charNum
+}
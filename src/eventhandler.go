@@ -0,0 +1,148 @@
+package main
+
+import "strings"
+
+// textEdit is one Insert or Remove applied to a buffer: the rune offset it
+// started at, the text it replaced, and the text it replaced that with.
+// Undo re-applies old in place of new; Redo re-applies new in place of old.
+type textEdit struct {
+	start    int
+	old, new string
+}
+
+// EventHandler applies Insert/Remove edits to a View's buffer and keeps an
+// undo/redo history of them. Edits made directly against the buffer instead
+// of through an EventHandler (there should be none) would not be undoable.
+//
+// By default each Insert/Remove is its own undo step. Group wraps a run of
+// edits so they undo and redo together as one step instead — see Replace,
+// which relies on this to make a whole-buffer find-and-replace a single
+// Ctrl-Z away from the original text.
+type EventHandler struct {
+	v *View
+
+	undoStack [][]textEdit
+	redoStack [][]textEdit
+
+	// group, while non-nil, collects edits made during a Group call instead
+	// of pushing each one as its own undo step.
+	group *[]textEdit
+}
+
+// NewEventHandler creates an EventHandler for v's buffer with empty
+// undo/redo history.
+func NewEventHandler(v *View) *EventHandler {
+	return &EventHandler{v: v}
+}
+
+// Insert inserts s at the rune offset loc.
+func (eh *EventHandler) Insert(loc int, s string) {
+	eh.edit(loc, "", s)
+}
+
+// Remove deletes the runes in [start, end).
+func (eh *EventHandler) Remove(start, end int) {
+	eh.edit(start, eh.textBetween(start, end), "")
+}
+
+// Group runs fn, recording every Insert/Remove it makes as a single undo
+// step instead of one step per call. A Group with no edits pushes nothing.
+func (eh *EventHandler) Group(fn func()) {
+	outer := eh.group
+	g := []textEdit{}
+	eh.group = &g
+	defer func() { eh.group = outer }()
+	fn()
+
+	if len(g) == 0 {
+		return
+	}
+	if outer != nil {
+		*outer = append(*outer, g...)
+	} else {
+		eh.pushUndo(g)
+	}
+}
+
+// Undo reverts the most recent undo step, moving it to the redo stack.
+func (eh *EventHandler) Undo() {
+	if len(eh.undoStack) == 0 {
+		return
+	}
+	g := eh.undoStack[len(eh.undoStack)-1]
+	eh.undoStack = eh.undoStack[:len(eh.undoStack)-1]
+
+	for i := len(g) - 1; i >= 0; i-- {
+		e := g[i]
+		eh.applyRaw(e.start, e.new, e.old)
+	}
+	eh.redoStack = append(eh.redoStack, g)
+}
+
+// Redo re-applies the most recently undone step, moving it back to the undo stack.
+func (eh *EventHandler) Redo() {
+	if len(eh.redoStack) == 0 {
+		return
+	}
+	g := eh.redoStack[len(eh.redoStack)-1]
+	eh.redoStack = eh.redoStack[:len(eh.redoStack)-1]
+
+	for _, e := range g {
+		eh.applyRaw(e.start, e.old, e.new)
+	}
+	eh.undoStack = append(eh.undoStack, g)
+}
+
+// edit applies a single Insert/Remove to the buffer and records it, either
+// into the enclosing Group or as its own undo step.
+func (eh *EventHandler) edit(start int, old, new string) {
+	eh.applyRaw(start, old, new)
+
+	e := textEdit{start: start, old: old, new: new}
+	if eh.group != nil {
+		*eh.group = append(*eh.group, e)
+	} else {
+		eh.pushUndo([]textEdit{e})
+	}
+}
+
+// pushUndo records g as a completed undo step and clears the redo stack,
+// since redoing past a fresh edit would resurrect text the user just
+// replaced.
+func (eh *EventHandler) pushUndo(g []textEdit) {
+	eh.undoStack = append(eh.undoStack, g)
+	eh.redoStack = nil
+}
+
+// applyRaw splices old out of the buffer at start and new in, without
+// touching either undo stack.
+func (eh *EventHandler) applyRaw(start int, old, new string) {
+	text := []rune(strings.Join(eh.v.buf.lines, "\n"))
+
+	end := start + len([]rune(old))
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+
+	merged := make([]rune, 0, len(text)-(end-start)+len([]rune(new)))
+	merged = append(merged, text[:start]...)
+	merged = append(merged, []rune(new)...)
+	merged = append(merged, text[end:]...)
+	eh.v.buf.lines = strings.Split(string(merged), "\n")
+}
+
+// textBetween returns the runes in [start, end) of the buffer, for Remove to
+// record as the old half of its textEdit.
+func (eh *EventHandler) textBetween(start, end int) string {
+	text := []rune(strings.Join(eh.v.buf.lines, "\n"))
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	return string(text[start:end])
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	lua "github.com/yuin/gopher-lua"
+	"path/filepath"
+)
+
+// plugins is the active plugin runtime, or nil if none has been loaded
+// (e.g. in tests, or if the config directory has no plugins). insertText
+// and actionSave check it for nil before firing hooks.
+var plugins *PluginManager
+
+// PluginManager embeds a Lua runtime and exposes the "micro" table plugin
+// scripts use to register new actions and hook into pre/post insert and
+// save events. Hooks and plugin-registered actions operate on whichever
+// View last called into the runtime, tracked in current.
+type PluginManager struct {
+	l *lua.LState
+
+	current *View
+
+	preInsert  []*lua.LFunction
+	postInsert []*lua.LFunction
+	preSave    []*lua.LFunction
+	postSave   []*lua.LFunction
+}
+
+// NewPluginManager creates a Lua runtime and registers the "micro" API
+// table plugins use.
+func NewPluginManager() *PluginManager {
+	pm := &PluginManager{l: lua.NewState()}
+
+	micro := pm.l.NewTable()
+	pm.l.SetGlobal("micro", micro)
+
+	pm.l.SetField(micro, "action", pm.l.NewFunction(pm.luaAction))
+	pm.l.SetField(micro, "onPreInsert", pm.l.NewFunction(pm.luaOnPreInsert))
+	pm.l.SetField(micro, "onPostInsert", pm.l.NewFunction(pm.luaOnPostInsert))
+	pm.l.SetField(micro, "onPreSave", pm.l.NewFunction(pm.luaOnPreSave))
+	pm.l.SetField(micro, "onPostSave", pm.l.NewFunction(pm.luaOnPostSave))
+	pm.l.SetField(micro, "insert", pm.l.NewFunction(pm.luaInsert))
+	pm.l.SetField(micro, "getLine", pm.l.NewFunction(pm.luaGetLine))
+	pm.l.SetField(micro, "lineCount", pm.l.NewFunction(pm.luaLineCount))
+
+	return pm
+}
+
+// LoadDir runs every *.lua file directly inside dir as a plugin. A missing
+// directory is not an error: it just means no plugins are loaded.
+func (pm *PluginManager) LoadDir(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		if err := pm.l.DoFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// luaAction implements micro.action(name, fn): fn becomes callable as an
+// action by name, the same as any built-in, reachable through bindings.go
+// or ViewManager.ExecuteCommand.
+func (pm *PluginManager) luaAction(l *lua.LState) int {
+	name := l.CheckString(1)
+	fn := l.CheckFunction(2)
+
+	actions[name] = func(v *View) RedrawHint {
+		pm.call(v, fn)
+		return dirtyAll(v)
+	}
+	return 0
+}
+
+func (pm *PluginManager) luaOnPreInsert(l *lua.LState) int {
+	pm.preInsert = append(pm.preInsert, l.CheckFunction(1))
+	return 0
+}
+
+func (pm *PluginManager) luaOnPostInsert(l *lua.LState) int {
+	pm.postInsert = append(pm.postInsert, l.CheckFunction(1))
+	return 0
+}
+
+func (pm *PluginManager) luaOnPreSave(l *lua.LState) int {
+	pm.preSave = append(pm.preSave, l.CheckFunction(1))
+	return 0
+}
+
+func (pm *PluginManager) luaOnPostSave(l *lua.LState) int {
+	pm.postSave = append(pm.postSave, l.CheckFunction(1))
+	return 0
+}
+
+// luaInsert implements micro.insert(text): inserts text at the current
+// view's cursor. This goes through v.eh directly rather than v.insertText,
+// since a preInsert hook calling micro.insert would otherwise re-enter
+// runHooks(preInsert, ...) recursively; it still bumps editGen itself so
+// the row it touched isn't served a stale pre-edit snapshot out of
+// v.lastFrame.
+func (pm *PluginManager) luaInsert(l *lua.LState) int {
+	if pm.current == nil {
+		return 0
+	}
+	text := l.CheckString(1)
+	pm.current.eh.Insert(pm.current.cursor.loc, text)
+	pm.current.editGen++
+	for i := 0; i < Count(text); i++ {
+		pm.current.cursor.Right()
+	}
+	return 0
+}
+
+// luaGetLine implements micro.getLine(n): returns the 1-indexed line n of
+// the current view's buffer.
+func (pm *PluginManager) luaGetLine(l *lua.LState) int {
+	if pm.current == nil {
+		l.Push(lua.LString(""))
+		return 1
+	}
+	n := l.CheckInt(1) - 1
+	if n < 0 || n >= len(pm.current.buf.lines) {
+		l.Push(lua.LString(""))
+		return 1
+	}
+	l.Push(lua.LString(pm.current.buf.lines[n]))
+	return 1
+}
+
+// luaLineCount implements micro.lineCount(): the number of lines in the
+// current view's buffer.
+func (pm *PluginManager) luaLineCount(l *lua.LState) int {
+	if pm.current == nil {
+		l.Push(lua.LNumber(0))
+		return 1
+	}
+	l.Push(lua.LNumber(len(pm.current.buf.lines)))
+	return 1
+}
+
+// runHooks calls every hook in fns against v, in registration order.
+func (pm *PluginManager) runHooks(fns []*lua.LFunction, v *View) {
+	for _, fn := range fns {
+		pm.call(v, fn)
+	}
+}
+
+// call invokes a Lua function with v set as the current view for the
+// duration of the call, so the micro.* functions above can reach it.
+func (pm *PluginManager) call(v *View, fn *lua.LFunction) {
+	prev := pm.current
+	pm.current = v
+	defer func() { pm.current = prev }()
+
+	pm.l.Push(fn)
+	if err := pm.l.PCall(0, 0, nil); err != nil {
+		v.m.Error(err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+// RedrawHint describes what part of the screen an event handler touched,
+// replacing the earlier 0/1/2 int convention. It lets a main loop batch
+// several input events into one frame: merge the hints with Merge and only
+// call Display once Dirty or Statusline is actually set, instead of
+// redrawing after every single keystroke.
+type RedrawHint struct {
+	// Dirty is whether the view needs repainting: its buffer content
+	// changed, or it scrolled, or its selection or search highlighting
+	// changed.
+	Dirty bool
+	// FromLine/ToLine bound the dirty logical line range (inclusive),
+	// meaningful only when Dirty is true.
+	FromLine, ToLine int
+	// Statusline is whether the statusline needs repainting, e.g. after a
+	// cursor move, even when Dirty is false.
+	Statusline bool
+}
+
+// Merge combines hints from two events handled in the same frame into the
+// hint that covers both.
+func (h RedrawHint) Merge(o RedrawHint) RedrawHint {
+	statusline := h.Statusline || o.Statusline
+	switch {
+	case !h.Dirty:
+		o.Statusline = statusline
+		return o
+	case !o.Dirty:
+		h.Statusline = statusline
+		return h
+	default:
+		if o.FromLine < h.FromLine {
+			h.FromLine = o.FromLine
+		}
+		if o.ToLine > h.ToLine {
+			h.ToLine = o.ToLine
+		}
+		h.Statusline = statusline
+		return h
+	}
+}
+
+// noRedraw reports that nothing on screen needs to change.
+func noRedraw() RedrawHint { return RedrawHint{} }
+
+// statusOnly reports that only the statusline needs repainting, e.g. after
+// a cursor move that didn't change any text.
+func statusOnly() RedrawHint { return RedrawHint{Statusline: true} }
+
+// dirtyLine reports that a single logical line changed.
+func dirtyLine(line int) RedrawHint {
+	return RedrawHint{Dirty: true, FromLine: line, ToLine: line, Statusline: true}
+}
+
+// dirtyFrom reports that every line from line to the end of v's buffer may
+// have changed, for edits (inserting/removing a newline) that shift later
+// lines.
+func dirtyFrom(line int, v *View) RedrawHint {
+	return RedrawHint{Dirty: true, FromLine: line, ToLine: len(v.buf.lines) - 1, Statusline: true}
+}
+
+// dirtyAll reports that the whole buffer may have changed, for edits whose
+// extent isn't easily bounded: undo/redo, replace-all, scrolling, a file
+// reload.
+func dirtyAll(v *View) RedrawHint {
+	return RedrawHint{Dirty: true, FromLine: 0, ToLine: len(v.buf.lines) - 1, Statusline: true}
+}
@@ -1,11 +1,10 @@
 package main
 
 import (
-	"github.com/atotto/clipboard"
 	"github.com/gdamore/tcell"
 	"io/ioutil"
 	"os"
-	"strconv"
+	"regexp"
 	"strings"
 )
 
@@ -15,6 +14,9 @@ import (
 type View struct {
 	cursor  Cursor
 	topline int
+	// Which wrapped visual row of the topline is drawn first, used when
+	// softWrap is on; topline itself always indexes a logical line.
+	topSubRow int
 	// Leftmost column. Used for horizontal scrolling
 	leftCol int
 
@@ -24,11 +26,33 @@ type View struct {
 	height        int
 	width         int
 
+	// softWrap wraps long logical lines across multiple screen rows
+	// instead of scrolling them off to the right.
+	softWrap bool
+
+	// editGen counts edits to this view's buffer, bumped by insertText and
+	// the few call sites that edit v.eh directly without going through it
+	// (DeleteSelection, actionBackspace, Undo/Redo, luaInsert). visualCache is rebuilt whenever it or
+	// the view width goes stale.
+	editGen     int
+	visualCache *visualLineCache
+
+	// Screen origin of this view. Both are 0 for a fullscreen view; a view
+	// that is part of a split layout is offset to its place in the tree by
+	// ViewManager.
+	x0, y0 int
+
 	// How much to offset because of line numbers
 	lineNumOffset int
 
 	eh *EventHandler
 
+	// ehByBuf caches this view's EventHandler per buffer, so switching
+	// buffers (setBuffer) scopes undo/redo history to the buffer it
+	// belongs to instead of applying it to whatever buffer is active when
+	// Undo/Redo runs.
+	ehByBuf map[*Buffer]*EventHandler
+
 	buf *Buffer
 	sl  Statusline
 
@@ -37,9 +61,28 @@ type View struct {
 	// Syntax highlighting matches
 	matches map[int]tcell.Style
 
+	// Incremental search state, set by Find and consumed by FindNext/
+	// FindPrevious until the user leaves search mode.
+	searchActive    bool
+	searchMatches   []int // char offsets of the start of each match
+	searchHighlight []int // char offsets written into matches, for cleanup
+	searchIndex     int
+	// searchGen is bumped whenever matches' search highlighting changes, so
+	// Display's per-row frame cache knows to repaint even though the
+	// underlying line text didn't change.
+	searchGen int
+
+	// lastFrame is what Display drew last time, used to skip repainting
+	// rows whose content and highlighting haven't changed since.
+	lastFrame *frameCache
+
 	m *Messenger
 
 	s tcell.Screen
+
+	// vm is set when this view is one split among others owned by a
+	// ViewManager, nil for a standalone fullscreen view.
+	vm *ViewManager
 }
 
 // NewView returns a new view with fullscreen width and height
@@ -68,6 +111,7 @@ func NewViewWidthHeight(buf *Buffer, m *Messenger, s tcell.Screen, w, h float32)
 	}
 
 	v.eh = NewEventHandler(v)
+	v.ehByBuf = map[*Buffer]*EventHandler{buf: v.eh}
 
 	v.sl = Statusline{
 		v: v,
@@ -76,6 +120,29 @@ func NewViewWidthHeight(buf *Buffer, m *Messenger, s tcell.Screen, w, h float32)
 	return v
 }
 
+// setBuffer switches this view to buf, reusing (or lazily creating) this
+// view's own EventHandler for it, so each buffer's undo/redo history stays
+// scoped to that buffer instead of leaking into whichever buffer happens
+// to be active the next time Undo/Redo runs.
+func (v *View) setBuffer(buf *Buffer) {
+	v.buf = buf
+
+	if v.ehByBuf == nil {
+		v.ehByBuf = map[*Buffer]*EventHandler{}
+	}
+	eh, ok := v.ehByBuf[buf]
+	if !ok {
+		eh = NewEventHandler(v)
+		v.ehByBuf[buf] = eh
+	}
+	v.eh = eh
+
+	v.topline = 0
+	v.topSubRow = 0
+	v.editGen++
+	v.cursor = Cursor{v: v}
+}
+
 // Resize recalculates the width and height of the view based on the width and height percentages
 func (v *View) Resize(w, h int) {
 	h--
@@ -83,256 +150,115 @@ func (v *View) Resize(w, h int) {
 	v.width = int(float32(w) * v.widthPercent)
 }
 
-// ScrollUp scrolls the view up n lines (if possible)
-func (v *View) ScrollUp(n int) {
-	// Try to scroll by n but if it would overflow, scroll by 1
-	if v.topline-n >= 0 {
-		v.topline -= n
-	} else if v.topline > 0 {
-		v.topline--
+// SetSize directly sets this view's width and height. ViewManager uses this
+// to size a split according to the split tree layout instead of the
+// heightPercent/widthPercent calculation Resize does for a fullscreen view.
+func (v *View) SetSize(w, h int) {
+	v.width = w
+	v.height = h
+}
+
+// SetPosition sets the screen origin this view draws from. ViewManager uses
+// this to place a split at its position in the terminal; a standalone
+// fullscreen view keeps the zero value.
+func (v *View) SetPosition(x, y int) {
+	v.x0 = x
+	v.y0 = y
+}
+
+// insertText inserts s at loc through v.eh, running any registered plugin
+// pre/post insert hooks around the edit.
+func (v *View) insertText(loc int, s string) {
+	if plugins != nil {
+		plugins.runHooks(plugins.preInsert, v)
+	}
+	v.eh.Insert(loc, s)
+	v.editGen++
+	if plugins != nil {
+		plugins.runHooks(plugins.postInsert, v)
 	}
 }
 
-// ScrollDown scrolls the view down n lines (if possible)
-func (v *View) ScrollDown(n int) {
-	// Try to scroll by n but if it would overflow, scroll by 1
-	if v.topline+n <= len(v.buf.lines)-v.height {
-		v.topline += n
-	} else if v.topline < len(v.buf.lines)-v.height {
-		v.topline++
+// Quit closes this view. If the view belongs to a ViewManager with other
+// splits still open, only this split is closed and the editor keeps
+// running; otherwise the whole editor exits.
+func (v *View) Quit() {
+	if v.vm != nil && v.vm.NumViews() > 1 {
+		v.vm.CloseView(v)
+		return
 	}
+	v.s.Fini()
+	os.Exit(0)
+}
+
+// ScrollUp scrolls the view up n visual rows (if possible). With soft-wrap
+// off a visual row is a logical line, same as before; with it on, this may
+// move within a wrapped logical line instead of all the way to the one
+// above.
+func (v *View) ScrollUp(n int) {
+	v.scrollVisual(-n)
+}
+
+// ScrollDown scrolls the view down n visual rows (if possible).
+func (v *View) ScrollDown(n int) {
+	v.scrollVisual(n)
 }
 
 // PageUp scrolls the view up a page
 func (v *View) PageUp() {
-	if v.topline > v.height {
-		v.ScrollUp(v.height)
-	} else {
-		v.topline = 0
-	}
+	v.scrollVisual(-v.height)
 }
 
 // PageDown scrolls the view down a page
 func (v *View) PageDown() {
-	if len(v.buf.lines)-(v.topline+v.height) > v.height {
-		v.ScrollDown(v.height)
-	} else {
-		v.topline = len(v.buf.lines) - v.height
-	}
+	v.scrollVisual(v.height)
 }
 
 // HalfPageUp scrolls the view up half a page
 func (v *View) HalfPageUp() {
-	if v.topline > v.height/2 {
-		v.ScrollUp(v.height / 2)
-	} else {
-		v.topline = 0
-	}
+	v.scrollVisual(-v.height / 2)
 }
 
 // HalfPageDown scrolls the view down half a page
 func (v *View) HalfPageDown() {
-	if len(v.buf.lines)-(v.topline+v.height) > v.height/2 {
-		v.ScrollDown(v.height / 2)
-	} else {
-		v.topline = len(v.buf.lines) - v.height
-	}
+	v.scrollVisual(v.height / 2)
 }
 
-// HandleEvent handles an event passed by the main loop
-// It returns an int describing how the screen needs to be redrawn
-// 0: Screen does not need to be redrawn
-// 1: Only the cursor/statusline needs to be redrawn
-// 2: Everything needs to be redrawn
-func (v *View) HandleEvent(event tcell.Event) int {
-	var ret int
+// HandleEvent handles an event passed by the main loop, returning a
+// RedrawHint describing how the screen needs to be redrawn. The main loop
+// can merge hints from several events (RedrawHint.Merge) before actually
+// drawing, instead of redrawing after every single one.
+func (v *View) HandleEvent(event tcell.Event) RedrawHint {
+	var ret RedrawHint
 	switch e := event.(type) {
 	case *tcell.EventResize:
 		// Window resized
 		v.Resize(e.Size())
-		ret = 2
+		ret = dirtyAll(v)
 	case *tcell.EventKey:
-		switch e.Key() {
-		case tcell.KeyCtrlQ:
-			// Quit
-			if v.buf.IsDirty() {
-				quit, canceled := v.m.Prompt("You have unsaved changes. Quit anyway? ")
-				if !canceled {
-					if strings.ToLower(quit) == "yes" || strings.ToLower(quit) == "y" {
-						v.s.Fini()
-						os.Exit(0)
-					} else {
-						return 2
-					}
-				} else {
-					return 2
-				}
-			} else {
-				v.s.Fini()
-				os.Exit(0)
-			}
-		case tcell.KeyUp:
-			// Cursor up
-			v.cursor.Up()
-			ret = 1
-		case tcell.KeyDown:
-			// Cursor down
-			v.cursor.Down()
-			ret = 1
-		case tcell.KeyLeft:
-			// Cursor left
-			v.cursor.Left()
-			ret = 1
-		case tcell.KeyRight:
-			// Cursor right
-			v.cursor.Right()
-			ret = 1
-		case tcell.KeyEnter:
-			// Insert a newline
-			v.eh.Insert(v.cursor.loc, "\n")
-			v.cursor.Right()
-			ret = 2
-		case tcell.KeySpace:
-			// Insert a space
-			v.eh.Insert(v.cursor.loc, " ")
-			v.cursor.Right()
-			ret = 2
-		case tcell.KeyBackspace2:
-			// Delete a character
+		if e.Key() == tcell.KeyRune && e.Modifiers() == 0 {
+			// A plain typed character is always a self-insert, never a bound
+			// chord
 			if v.cursor.HasSelection() {
 				v.cursor.DeleteSelection()
 				v.cursor.ResetSelection()
-				ret = 2
-			} else if v.cursor.loc > 0 {
-				// We have to do something a bit hacky here because we want to
-				// delete the line by first moving left and then deleting backwards
-				// but the undo redo would place the cursor in the wrong place
-				// So instead we move left, save the position, move back, delete
-				// and restore the position
-				v.cursor.Left()
-				cx, cy, cloc := v.cursor.x, v.cursor.y, v.cursor.loc
-				v.cursor.Right()
-				v.eh.Remove(v.cursor.loc-1, v.cursor.loc)
-				v.cursor.x, v.cursor.y, v.cursor.loc = cx, cy, cloc
-				ret = 2
 			}
-		case tcell.KeyTab:
-			// Insert a tab
-			v.eh.Insert(v.cursor.loc, "\t")
+			line := v.cursor.y
+			v.insertText(v.cursor.loc, string(e.Rune()))
 			v.cursor.Right()
-			ret = 2
-		case tcell.KeyCtrlS:
-			// Save
-			if v.buf.path == "" {
-				filename, canceled := v.m.Prompt("Filename: ")
-				if !canceled {
-					v.buf.path = filename
-					v.buf.name = filename
-				} else {
-					return 2
-				}
-			}
-			err := v.buf.Save()
-			if err != nil {
-				v.m.Error(err.Error())
+			ret = dirtyLine(line)
+		} else if v.searchActive && e.Key() == tcell.KeyEnter && e.Modifiers()&tcell.ModShift != 0 {
+			// Shift-Enter steps back to the previous search match
+			v.FindPrevious()
+			ret = dirtyAll(v)
+		} else if name, ok := bindings[chordString(e)]; ok {
+			if action, ok := actions[name]; ok {
+				ret = action(v)
 			}
-			// Need to redraw the status line
-			ret = 1
-		case tcell.KeyCtrlZ:
-			// Undo
-			v.eh.Undo()
-			ret = 2
-		case tcell.KeyCtrlY:
-			// Redo
-			v.eh.Redo()
-			ret = 2
-		case tcell.KeyCtrlC:
-			// Copy
-			if v.cursor.HasSelection() {
-				if !clipboard.Unsupported {
-					clipboard.WriteAll(v.cursor.GetSelection())
-					ret = 2
-				}
-			}
-		case tcell.KeyCtrlX:
-			// Cut
-			if v.cursor.HasSelection() {
-				if !clipboard.Unsupported {
-					clipboard.WriteAll(v.cursor.GetSelection())
-					v.cursor.DeleteSelection()
-					v.cursor.ResetSelection()
-					ret = 2
-				}
-			}
-		case tcell.KeyCtrlV:
-			// Paste
-			if !clipboard.Unsupported {
-				if v.cursor.HasSelection() {
-					v.cursor.DeleteSelection()
-					v.cursor.ResetSelection()
-				}
-				clip, _ := clipboard.ReadAll()
-				v.eh.Insert(v.cursor.loc, clip)
-				// This is a bit weird... Not sure if there's a better way
-				for i := 0; i < Count(clip); i++ {
-					v.cursor.Right()
-				}
-				ret = 2
-			}
-		case tcell.KeyCtrlA:
-			// Select all
-			v.cursor.selectionEnd = 0
-			v.cursor.selectionStart = v.buf.Len()
-			v.cursor.x = 0
-			v.cursor.y = 0
-			v.cursor.loc = 0
-			ret = 2
-		case tcell.KeyCtrlO:
-			// Open file
-			if v.buf.IsDirty() {
-				quit, canceled := v.m.Prompt("You have unsaved changes. Continue? ")
-				if !canceled {
-					if strings.ToLower(quit) == "yes" || strings.ToLower(quit) == "y" {
-						return v.OpenFile()
-					} else {
-						return 2
-					}
-				} else {
-					return 2
-				}
-			} else {
-				return v.OpenFile()
-			}
-		case tcell.KeyPgUp:
-			// Page up
-			v.PageUp()
-			return 2
-		case tcell.KeyPgDn:
-			// Page down
-			v.PageDown()
-			return 2
-		case tcell.KeyCtrlU:
-			// Half page up
-			v.HalfPageUp()
-			return 2
-		case tcell.KeyCtrlD:
-			// Half page down
-			v.HalfPageDown()
-			return 2
-		case tcell.KeyRune:
-			// Insert a character
-			if v.cursor.HasSelection() {
-				v.cursor.DeleteSelection()
-				v.cursor.ResetSelection()
-			}
-			v.eh.Insert(v.cursor.loc, string(e.Rune()))
-			v.cursor.Right()
-			ret = 2
 		}
 	case *tcell.EventMouse:
 		x, y := e.Position()
 		x -= v.lineNumOffset
-		y += v.topline
 		// Position always seems to be off by one
 		x--
 		y--
@@ -342,25 +268,30 @@ func (v *View) HandleEvent(event tcell.Event) int {
 		switch button {
 		case tcell.Button1:
 			// Left click
-			if y-v.topline > v.height-1 {
+			if y > v.height-1 {
 				v.ScrollDown(1)
-				y = v.height + v.topline - 1
+				y = v.height - 1
 			}
-			if y >= len(v.buf.lines) {
-				y = len(v.buf.lines) - 1
+			if y < 0 {
+				y = 0
 			}
 			if x < 0 {
 				x = 0
 			}
 
-			x = v.cursor.GetCharPosInLine(y, x)
-			if x > Count(v.buf.lines[y]) {
-				x = Count(v.buf.lines[y])
+			// y is a screen row, not a logical line: walk the wrapped rows
+			// from (topline, topSubRow) the same way Display does, since
+			// with soft-wrap on they aren't the same thing.
+			line, visualX := v.screenToLinePos(y, x)
+
+			cx := v.cursor.GetCharPosInLine(line, visualX)
+			if cx > Count(v.buf.lines[line]) {
+				cx = Count(v.buf.lines[line])
 			}
-			d := v.cursor.Distance(x, y)
+			d := v.cursor.Distance(cx, line)
 			v.cursor.loc += d
-			v.cursor.x = x
-			v.cursor.y = y
+			v.cursor.x = cx
+			v.cursor.y = line
 
 			if v.mouseReleased {
 				v.cursor.selectionStart = v.cursor.loc
@@ -369,22 +300,22 @@ func (v *View) HandleEvent(event tcell.Event) int {
 			}
 			v.cursor.selectionEnd = v.cursor.loc
 			v.mouseReleased = false
-			return 2
+			return dirtyAll(v)
 		case tcell.ButtonNone:
 			// Mouse event with no click
 			v.mouseReleased = true
 			// We need to directly return here because otherwise the view will
 			// be readjusted to put the cursor in it, but there may be mouse events
 			// where the cursor is not (and should not be) be involved
-			return 0
+			return noRedraw()
 		case tcell.WheelUp:
 			// Scroll up two lines
 			v.ScrollUp(2)
-			return 2
+			return dirtyAll(v)
 		case tcell.WheelDown:
 			// Scroll down two lines
 			v.ScrollDown(2)
-			return 2
+			return dirtyAll(v)
 		}
 	}
 
@@ -392,125 +323,231 @@ func (v *View) HandleEvent(event tcell.Event) int {
 	cy := v.cursor.y
 	if cy < v.topline {
 		v.topline = cy
-		ret = 2
+		v.topSubRow = 0
+		ret = dirtyAll(v)
 	}
 	if cy > v.topline+v.height-1 {
 		v.topline = cy - v.height + 1
-		ret = 2
+		v.topSubRow = 0
+		ret = dirtyAll(v)
 	}
 
 	return ret
 }
 
 // OpenFile Prompts the user for a filename and opens the file in the current buffer
-func (v *View) OpenFile() int {
+func (v *View) OpenFile() RedrawHint {
 	filename, canceled := v.m.Prompt("File to open: ")
 	if canceled {
-		return 2
+		return dirtyAll(v)
 	}
 	file, err := ioutil.ReadFile(filename)
 
 	if err != nil {
 		v.m.Error(err.Error())
-		return 2
+		return dirtyAll(v)
+	}
+	v.setBuffer(NewBuffer(string(file), filename))
+	if v.vm != nil {
+		v.vm.OpenBuffer(v.buf)
+	}
+	return dirtyAll(v)
+}
+
+// runeOffset converts a byte offset into s to the corresponding rune
+// offset, since regexp match indices are byte offsets but matches, like
+// cursor.loc, is indexed by rune.
+func runeOffset(s string, byteIdx int) int {
+	return len([]rune(s[:byteIdx]))
+}
+
+// locToPos converts an absolute rune offset within the buffer into the
+// (col, line) position View and Cursor otherwise track, by walking the
+// buffer the same way Display does.
+func (v *View) locToPos(loc int) (x, y int) {
+	remaining := loc
+	for i, line := range v.buf.lines {
+		n := Count(line) + 1 // +1 for the implicit newline
+		if remaining < n || i == len(v.buf.lines)-1 {
+			return remaining, i
+		}
+		remaining -= n
 	}
-	v.buf = NewBuffer(string(file), filename)
-	return 2
+	return 0, 0
 }
 
-// Display renders the view to the screen
-func (v *View) Display() {
-	var x int
+// Find prompts for a search query via Messenger, highlights every match in
+// matches using colorscheme["search-match"], and jumps the cursor to the
+// first match. While search mode is active, Enter/Shift-Enter (handled in
+// HandleEvent) move to the next/previous match instead of inserting a
+// newline; Esc or another Ctrl-F leaves search mode and clears the
+// highlighting.
+func (v *View) Find() {
+	if v.searchActive {
+		v.clearSearch()
+	}
 
-	charNum := v.cursor.loc + v.cursor.Distance(0, v.topline)
+	query, canceled := v.m.Prompt("Find: ")
+	if canceled || query == "" {
+		return
+	}
 
-	// Convert the length of buffer to a string, and get the length of the string
-	// We are going to have to offset by that amount
-	maxLineLength := len(strconv.Itoa(len(v.buf.lines)))
-	// + 1 for the little space after the line number
-	v.lineNumOffset = maxLineLength + 1
+	re, err := regexp.Compile(query)
+	if err != nil {
+		v.m.Error(err.Error())
+		return
+	}
 
-	var highlightStyle tcell.Style
+	style := tcell.StyleDefault.Reverse(true)
+	if s, ok := colorscheme["search-match"]; ok {
+		style = s
+	}
 
-	for lineN := 0; lineN < v.height; lineN++ {
-		if lineN+v.topline >= len(v.buf.lines) {
-			break
-		}
-		line := v.buf.lines[lineN+v.topline]
+	if v.matches == nil {
+		v.matches = make(map[int]tcell.Style)
+	}
 
-		// Write the line number
-		lineNumStyle := tcell.StyleDefault
-		if _, ok := colorscheme["line-number"]; ok {
-			lineNumStyle = colorscheme["line-number"]
+	text := strings.Join(v.buf.lines, "\n")
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		start, end := runeOffset(text, loc[0]), runeOffset(text, loc[1])
+		v.searchMatches = append(v.searchMatches, start)
+		for i := start; i < end; i++ {
+			v.matches[i] = style
+			v.searchHighlight = append(v.searchHighlight, i)
 		}
-		// Write the spaces before the line number if necessary
-		lineNum := strconv.Itoa(lineN + v.topline + 1)
-		for i := 0; i < maxLineLength-len(lineNum); i++ {
-			v.s.SetContent(x, lineN, ' ', nil, lineNumStyle)
-			x++
-		}
-		// Write the actual line number
-		for _, ch := range lineNum {
-			v.s.SetContent(x, lineN, ch, nil, lineNumStyle)
-			x++
-		}
-		// Write the extra space
-		v.s.SetContent(x, lineN, ' ', nil, lineNumStyle)
-		x++
-
-		// Write the line
-		tabchars := 0
-		for _, ch := range line {
-			var lineStyle tcell.Style
-			st, ok := v.matches[charNum]
-			if ok {
-				highlightStyle = st
-			} else {
-				highlightStyle = tcell.StyleDefault
-			}
+	}
 
-			if v.cursor.HasSelection() &&
-				(charNum >= v.cursor.selectionStart && charNum <= v.cursor.selectionEnd ||
-					charNum <= v.cursor.selectionStart && charNum >= v.cursor.selectionEnd) {
+	if len(v.searchMatches) == 0 {
+		v.m.Error("No matches for " + query)
+		return
+	}
 
-				lineStyle = tcell.StyleDefault.Reverse(true)
+	v.searchActive = true
+	v.searchIndex = -1
+	v.searchGen++
+	v.FindNext()
+}
 
-				if _, ok := colorscheme["selection"]; ok {
-					lineStyle = colorscheme["selection"]
-				}
-			} else {
-				lineStyle = highlightStyle
-			}
+// FindNext jumps the cursor to the next search match, wrapping around.
+func (v *View) FindNext() {
+	if !v.searchActive || len(v.searchMatches) == 0 {
+		return
+	}
+	v.searchIndex = (v.searchIndex + 1) % len(v.searchMatches)
+	v.jumpToMatch(v.searchMatches[v.searchIndex])
+}
 
-			if ch == '\t' {
-				v.s.SetContent(x+tabchars, lineN, ' ', nil, lineStyle)
-				for i := 0; i < tabSize-1; i++ {
-					tabchars++
-					v.s.SetContent(x+tabchars, lineN, ' ', nil, lineStyle)
-				}
-			} else {
-				v.s.SetContent(x+tabchars, lineN, ch, nil, lineStyle)
-			}
-			charNum++
-			x++
-		}
-		if v.cursor.HasSelection() &&
-			(charNum >= v.cursor.selectionStart && charNum <= v.cursor.selectionEnd ||
-				charNum <= v.cursor.selectionStart && charNum >= v.cursor.selectionEnd) {
+// FindPrevious jumps the cursor to the previous search match, wrapping
+// around.
+func (v *View) FindPrevious() {
+	if !v.searchActive || len(v.searchMatches) == 0 {
+		return
+	}
+	v.searchIndex--
+	if v.searchIndex < 0 {
+		v.searchIndex = len(v.searchMatches) - 1
+	}
+	v.jumpToMatch(v.searchMatches[v.searchIndex])
+}
+
+func (v *View) jumpToMatch(loc int) {
+	x, y := v.locToPos(loc)
+	v.cursor.loc = loc
+	v.cursor.x = x
+	v.cursor.y = y
+}
 
-			selectStyle := tcell.StyleDefault.Reverse(true)
+// clearSearch removes search highlighting and leaves search mode.
+func (v *View) clearSearch() {
+	for _, loc := range v.searchHighlight {
+		delete(v.matches, loc)
+	}
+	v.searchActive = false
+	v.searchMatches = nil
+	v.searchHighlight = nil
+	v.searchIndex = 0
+	v.searchGen++
+}
+
+// Replace prompts for a search pattern and a replacement (Go regexp
+// syntax; the replacement may use $1-style backreferences), then steps
+// through every match asking for y/n/a/q confirmation via Messenger.Prompt
+// ("yes", "no", "all", "quit"). Accepted replacements are applied as a
+// whole-buffer Remove followed by an Insert, grouped through v.eh.Group so
+// the two are one undo step: a single Ctrl-Z restores the original text.
+func (v *View) Replace() {
+	pattern, canceled := v.m.Prompt("Replace: ")
+	if canceled || pattern == "" {
+		return
+	}
+	replacement, canceled := v.m.Prompt("With: ")
+	if canceled {
+		return
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		v.m.Error(err.Error())
+		return
+	}
 
-			if _, ok := colorscheme["selection"]; ok {
-				selectStyle = colorscheme["selection"]
+	src := []byte(strings.Join(v.buf.lines, "\n"))
+	matches := re.FindAllSubmatchIndex(src, -1)
+	if len(matches) == 0 {
+		v.m.Error("No matches for " + pattern)
+		return
+	}
+
+	var out []byte
+	last := 0
+	replaceAll := false
+	changed := false
+
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		out = append(out, src[last:start]...)
+
+		accept := replaceAll
+		if !accept {
+			ans, canceled := v.m.Prompt("Replace this match? (y/n/a/q) ")
+			if canceled {
+				ans = "q"
+			}
+			switch strings.ToLower(ans) {
+			case "y":
+				accept = true
+			case "a":
+				accept = true
+				replaceAll = true
+			case "q":
+				out = append(out, src[start:]...)
+				last = len(src)
 			}
-			v.s.SetContent(x+tabchars, lineN, ' ', nil, selectStyle)
 		}
 
-		x = 0
-		st, ok := v.matches[charNum]
-		if ok {
-			highlightStyle = st
+		if last == len(src) {
+			break
+		}
+
+		if accept {
+			out = re.Expand(out, []byte(replacement), src, m)
+			changed = true
+		} else {
+			out = append(out, src[start:end]...)
 		}
-		charNum++
+		last = end
+	}
+	out = append(out, src[last:]...)
+
+	if !changed {
+		return
 	}
-}
\ No newline at end of file
+
+	v.eh.Group(func() {
+		v.eh.Remove(0, v.buf.Len())
+		v.insertText(0, string(out))
+	})
+	v.cursor.loc = 0
+	v.cursor.x = 0
+	v.cursor.y = 0
+}
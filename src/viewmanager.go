@@ -0,0 +1,549 @@
+package main
+
+import (
+	"github.com/gdamore/tcell"
+	"strconv"
+	"strings"
+)
+
+// splitDir identifies one of the four directions a split can be focused in.
+type splitDir int
+
+const (
+	DirLeft splitDir = iota
+	DirRight
+	DirUp
+	DirDown
+)
+
+// splitOrientation describes whether a split node's children sit side by
+// side (vertical split) or are stacked (horizontal split). A leaf node has
+// orientation splitNone and wraps a single View instead.
+type splitOrientation int
+
+const (
+	splitNone splitOrientation = iota
+	splitVertical
+	splitHorizontal
+)
+
+// splitNode is one node of the split tree. A leaf (view != nil) wraps a
+// single View; an internal node arranges its children according to
+// orientation, each taking the fraction of the node's rectangle given by
+// the matching entry in ratios.
+type splitNode struct {
+	parent      *splitNode
+	orientation splitOrientation
+	children    []*splitNode
+	ratios      []float32
+
+	view *View
+
+	// Last rectangle this node was laid out into, in terminal cells.
+	x, y, w, h int
+}
+
+// ViewManager owns the tree of split views and the registry of open
+// buffers. It is the top-level event and display dispatcher, replacing a
+// single fullscreen View.
+type ViewManager struct {
+	root   *splitNode
+	active *splitNode
+
+	buffers []*Buffer
+
+	awaitingSplitCmd bool
+
+	s tcell.Screen
+	m *Messenger
+}
+
+// NewViewManager creates a ViewManager with a single fullscreen view over buf.
+func NewViewManager(buf *Buffer, m *Messenger, s tcell.Screen) *ViewManager {
+	vm := &ViewManager{
+		buffers: []*Buffer{buf},
+		s:       s,
+		m:       m,
+	}
+
+	v := NewView(buf, m, s)
+	v.vm = vm
+
+	leaf := &splitNode{view: v}
+	vm.root = leaf
+	vm.active = leaf
+
+	vm.Resize(s.Size())
+
+	return vm
+}
+
+// NumViews returns the number of open splits.
+func (vm *ViewManager) NumViews() int {
+	return countLeaves(vm.root)
+}
+
+func countLeaves(n *splitNode) int {
+	if n == nil {
+		return 0
+	}
+	if n.view != nil {
+		return 1
+	}
+	total := 0
+	for _, c := range n.children {
+		total += countLeaves(c)
+	}
+	return total
+}
+
+// Resize recomputes every split's rectangle from the terminal size.
+func (vm *ViewManager) Resize(w, h int) {
+	layout(vm.root, 0, 0, w, h)
+}
+
+// layout assigns (x, y, w, h) to node and, recursively, to its children,
+// dividing the rectangle along node's orientation according to ratios. A
+// leaf applies its rectangle straight to the View it wraps.
+func layout(node *splitNode, x, y, w, h int) {
+	node.x, node.y, node.w, node.h = x, y, w, h
+
+	if node.view != nil {
+		node.view.SetPosition(x, y)
+		node.view.SetSize(w, h)
+		return
+	}
+
+	switch node.orientation {
+	case splitVertical:
+		cx := x
+		for i, c := range node.children {
+			cw := int(float32(w) * node.ratios[i])
+			if i == len(node.children)-1 {
+				cw = w - (cx - x)
+			}
+			layout(c, cx, y, cw, h)
+			cx += cw
+		}
+	case splitHorizontal:
+		cy := y
+		for i, c := range node.children {
+			ch := int(float32(h) * node.ratios[i])
+			if i == len(node.children)-1 {
+				ch = h - (cy - y)
+			}
+			layout(c, x, cy, w, ch)
+			cy += ch
+		}
+	}
+}
+
+// Split replaces the active leaf with a split node containing the original
+// view and a new view over the same buffer, then re-lays-out the whole
+// tree and focuses the new view. vertical selects a side-by-side split;
+// otherwise the split stacks the views top/bottom.
+func (vm *ViewManager) Split(vertical bool) {
+	old := vm.active
+	if old == nil || old.view == nil {
+		return
+	}
+
+	newView := NewView(old.view.buf, vm.m, vm.s)
+	newView.vm = vm
+
+	orientation := splitHorizontal
+	if vertical {
+		orientation = splitVertical
+	}
+
+	split := &splitNode{
+		parent:      old.parent,
+		orientation: orientation,
+		ratios:      []float32{0.5, 0.5},
+	}
+	split.children = []*splitNode{
+		{parent: split, view: old.view},
+		{parent: split, view: newView},
+	}
+
+	if old.parent == nil {
+		vm.root = split
+	} else {
+		for i, c := range old.parent.children {
+			if c == old {
+				old.parent.children[i] = split
+				break
+			}
+		}
+	}
+
+	vm.active = split.children[1]
+	vm.Resize(vm.s.Size())
+}
+
+// Close removes the active split, collapsing its parent and focusing a
+// neighbouring split. It is a no-op if this is the only view open; use
+// View.Quit to exit the editor in that case.
+func (vm *ViewManager) Close() {
+	vm.CloseView(vm.active.view)
+}
+
+// CloseView removes the split containing v from the tree, collapsing its
+// parent if that leaves a single sibling, and focuses that sibling.
+func (vm *ViewManager) CloseView(v *View) {
+	leaf := findLeaf(vm.root, v)
+	if leaf == nil || leaf.parent == nil {
+		// Last remaining view: nothing to collapse into.
+		return
+	}
+
+	parent := leaf.parent
+	var sibling *splitNode
+	for _, c := range parent.children {
+		if c != leaf {
+			sibling = c
+			break
+		}
+	}
+
+	if parent.parent == nil {
+		vm.root = sibling
+	} else {
+		for i, c := range parent.parent.children {
+			if c == parent {
+				parent.parent.children[i] = sibling
+				break
+			}
+		}
+	}
+	sibling.parent = parent.parent
+
+	vm.active = firstLeaf(sibling)
+	vm.Resize(vm.s.Size())
+}
+
+func findLeaf(n *splitNode, v *View) *splitNode {
+	if n == nil {
+		return nil
+	}
+	if n.view == v {
+		return n
+	}
+	for _, c := range n.children {
+		if found := findLeaf(c, v); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func firstLeaf(n *splitNode) *splitNode {
+	if n.view != nil {
+		return n
+	}
+	return firstLeaf(n.children[0])
+}
+
+// FocusDirection moves the active split to the nearest neighbouring leaf in
+// the given direction, based on each leaf's last laid-out rectangle.
+func (vm *ViewManager) FocusDirection(dir splitDir) {
+	if vm.active == nil {
+		return
+	}
+	cur := vm.active
+	cx, cy := cur.x+cur.w/2, cur.y+cur.h/2
+
+	var best *splitNode
+	bestDist := -1
+
+	var visit func(n *splitNode)
+	visit = func(n *splitNode) {
+		if n == nil {
+			return
+		}
+		if n.view != nil {
+			if n == cur {
+				return
+			}
+			nx, ny := n.x+n.w/2, n.y+n.h/2
+			switch dir {
+			case DirLeft:
+				if nx >= cx {
+					return
+				}
+			case DirRight:
+				if nx <= cx {
+					return
+				}
+			case DirUp:
+				if ny >= cy {
+					return
+				}
+			case DirDown:
+				if ny <= cy {
+					return
+				}
+			}
+			dist := (nx-cx)*(nx-cx) + (ny-cy)*(ny-cy)
+			if bestDist == -1 || dist < bestDist {
+				bestDist = dist
+				best = n
+			}
+			return
+		}
+		for _, c := range n.children {
+			visit(c)
+		}
+	}
+	visit(vm.root)
+
+	if best != nil {
+		vm.active = best
+	}
+}
+
+// OpenBuffer registers buf in the buffer list so it can be switched to with
+// SwitchBuffer/NextBuffer, if it is not already open.
+func (vm *ViewManager) OpenBuffer(buf *Buffer) {
+	for _, b := range vm.buffers {
+		if b == buf {
+			return
+		}
+	}
+	vm.buffers = append(vm.buffers, buf)
+}
+
+// SwitchBuffer points the active view at the n-th open buffer (0-indexed),
+// scoping undo/redo history to that buffer (see View.setBuffer).
+func (vm *ViewManager) SwitchBuffer(n int) {
+	if vm.active == nil || n < 0 || n >= len(vm.buffers) {
+		return
+	}
+	vm.active.view.setBuffer(vm.buffers[n])
+}
+
+// NextBuffer switches the active view to the next buffer in the registry,
+// wrapping around. Bound to Ctrl-Tab.
+func (vm *ViewManager) NextBuffer() {
+	if vm.active == nil || len(vm.buffers) == 0 {
+		return
+	}
+	cur := 0
+	for i, b := range vm.buffers {
+		if b == vm.active.view.buf {
+			cur = i
+			break
+		}
+	}
+	vm.SwitchBuffer((cur + 1) % len(vm.buffers))
+}
+
+// ExecuteCommand runs a single command-mode input: the window/buffer
+// commands "vsplit", "split", "close" and "buffer N" handled directly here,
+// "w"/"q" as aliases for the Save/Quit actions, "set" for editor options,
+// and any other name looked up in the actions registry so plugin-defined
+// actions are reachable from the command line too.
+func (vm *ViewManager) ExecuteCommand(cmd string) {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch fields[0] {
+	case "vsplit":
+		vm.Split(true)
+	case "split":
+		vm.Split(false)
+	case "close":
+		vm.Close()
+	case "buffer":
+		if len(fields) < 2 {
+			return
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			vm.m.Error("Invalid buffer number: " + fields[1])
+			return
+		}
+		vm.SwitchBuffer(n - 1)
+	case "w":
+		vm.runAction("Save")
+	case "q":
+		vm.runAction("Quit")
+	case "set":
+		vm.executeSet(fields[1:])
+	default:
+		vm.runAction(fields[0])
+	}
+}
+
+// runAction invokes a registered action against the active view, if any,
+// and returns its RedrawHint: noRedraw if there is no active view, and
+// dirtyAll for an unknown action, so callers don't need to special-case the
+// no-op.
+func (vm *ViewManager) runAction(name string) RedrawHint {
+	if vm.active == nil {
+		return noRedraw()
+	}
+	if action, ok := actions[name]; ok {
+		return action(vm.active.view)
+	}
+	return dirtyAll(vm.active.view)
+}
+
+// executeSet handles "set <option> <value>" commands, e.g. "set tabsize 2"
+// or "set wrap on".
+func (vm *ViewManager) executeSet(args []string) {
+	if len(args) < 2 {
+		return
+	}
+
+	switch args[0] {
+	case "tabsize":
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			vm.m.Error("Invalid tabsize: " + args[1])
+			return
+		}
+		tabSize = n
+	case "wrap":
+		if vm.active == nil {
+			return
+		}
+		v := vm.active.view
+		switch args[1] {
+		case "on":
+			v.softWrap = true
+			v.editGen++
+		case "off":
+			v.softWrap = false
+			v.editGen++
+		default:
+			vm.m.Error("Invalid wrap setting: " + args[1])
+		}
+	default:
+		vm.m.Error("Unknown option: " + args[0])
+	}
+}
+
+// handleSplitCommand interprets the key chord following Ctrl-W: s/v split
+// the active view horizontally/vertically, c closes it, and the arrow keys
+// move focus to the neighbouring split in that direction.
+func (vm *ViewManager) handleSplitCommand(e *tcell.EventKey) RedrawHint {
+	if vm.active == nil {
+		return noRedraw()
+	}
+	switch e.Key() {
+	case tcell.KeyRune:
+		switch e.Rune() {
+		case 's':
+			vm.Split(false)
+		case 'v':
+			vm.Split(true)
+		case 'c':
+			vm.Close()
+		}
+	case tcell.KeyLeft:
+		vm.FocusDirection(DirLeft)
+	case tcell.KeyRight:
+		vm.FocusDirection(DirRight)
+	case tcell.KeyUp:
+		vm.FocusDirection(DirUp)
+	case tcell.KeyDown:
+		vm.FocusDirection(DirDown)
+	}
+	return dirtyAll(vm.active.view)
+}
+
+// viewAt returns the leaf whose rectangle contains the given mouse event's
+// position, or nil if it falls outside every split.
+func (vm *ViewManager) viewAt(e *tcell.EventMouse) *splitNode {
+	x, y := e.Position()
+
+	var found *splitNode
+	var visit func(n *splitNode)
+	visit = func(n *splitNode) {
+		if n == nil || found != nil {
+			return
+		}
+		if n.view != nil {
+			if x >= n.x && x < n.x+n.w && y >= n.y && y < n.y+n.h {
+				found = n
+			}
+			return
+		}
+		for _, c := range n.children {
+			visit(c)
+		}
+	}
+	visit(vm.root)
+	return found
+}
+
+// translateMouse rewrites a mouse event's position from terminal-absolute
+// coordinates to coordinates relative to the given split's origin, so the
+// target View can keep handling mouse input exactly as it does fullscreen.
+func (vm *ViewManager) translateMouse(e *tcell.EventMouse, target *splitNode) *tcell.EventMouse {
+	x, y := e.Position()
+	return tcell.NewEventMouse(x-target.x, y-target.y, e.Buttons(), e.Modifiers())
+}
+
+// HandleEvent is the top-level event entry point, used in place of a bare
+// View's HandleEvent. It intercepts window-management and buffer-switching
+// chords itself and routes everything else to whichever split is under the
+// mouse or currently focused.
+func (vm *ViewManager) HandleEvent(event tcell.Event) RedrawHint {
+	switch e := event.(type) {
+	case *tcell.EventResize:
+		vm.Resize(e.Size())
+		if vm.active == nil {
+			return noRedraw()
+		}
+		return dirtyAll(vm.active.view)
+	case *tcell.EventKey:
+		if vm.awaitingSplitCmd {
+			vm.awaitingSplitCmd = false
+			return vm.handleSplitCommand(e)
+		}
+		if e.Key() == tcell.KeyCtrlW {
+			vm.awaitingSplitCmd = true
+			return statusOnly()
+		}
+		if e.Key() == tcell.KeyTab && e.Modifiers()&tcell.ModCtrl != 0 {
+			vm.NextBuffer()
+			if vm.active == nil {
+				return noRedraw()
+			}
+			return dirtyAll(vm.active.view)
+		}
+	case *tcell.EventMouse:
+		if target := vm.viewAt(e); target != nil {
+			vm.active = target
+			return target.view.HandleEvent(vm.translateMouse(e, target))
+		}
+		return noRedraw()
+	}
+
+	if vm.active == nil {
+		return noRedraw()
+	}
+	return vm.active.view.HandleEvent(event)
+}
+
+// Display renders every open split.
+func (vm *ViewManager) Display() {
+	var visit func(n *splitNode)
+	visit = func(n *splitNode) {
+		if n == nil {
+			return
+		}
+		if n.view != nil {
+			n.view.Display()
+			return
+		}
+		for _, c := range n.children {
+			visit(c)
+		}
+	}
+	visit(vm.root)
+}